@@ -2,142 +2,299 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"net/http"
-	"os"
+	"net/http/pprof"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
 	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
 	larkws "github.com/larksuite/oapi-sdk-go/v3/ws"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 
-	"github.com/wuhuizuo/caffeine-overflow/lark-bot/pkg/botinfo"
+	"github.com/wuhuizuo/caffeine-overflow/lark-bot/pkg/config"
 	"github.com/wuhuizuo/caffeine-overflow/lark-bot/pkg/events/handler"
+	"github.com/wuhuizuo/caffeine-overflow/lark-bot/pkg/metrics"
+	"github.com/wuhuizuo/caffeine-overflow/lark-bot/pkg/transport"
 )
 
 func main() {
 	var (
 		// Flags still define defaults and allow overrides
-		appID       = flag.String("app-id", "", "app id (overrides config if provided)")
-		appSecret   = flag.String("app-secret", "", "app secret (overrides config if provided)")
-		config      = flag.String("config", "config.yaml", "config yaml file")
-		debugMode   = flag.Bool("debug", false, "debug mode")
-		httpAddress = flag.String("http-addr", ":8080", "HTTP listen address for health checks")
+		appID         = flag.String("app-id", "", "app id (overrides config if provided)")
+		appSecret     = flag.String("app-secret", "", "app secret (overrides config if provided)")
+		configFile    = flag.String("config", "config.yaml", "config yaml file")
+		debugMode     = flag.Bool("debug", false, "debug mode")
+		httpAddress   = flag.String("http-addr", "", "HTTP listen address for health checks (overrides config if provided, default :8080)")
+		transportFlag = flag.String("transport", "", "event transport: ws (default) or http")
+		shutdownGrace = flag.Duration("shutdown-grace", 0, "max time to wait for in-flight handlers to drain on shutdown (overrides config if provided, default 10s)")
 	)
 	flag.Parse()
 
+	// Cancelled on SIGINT/SIGTERM; threaded through the WebSocket consumer
+	// and the health/event HTTP server so Kubernetes can drain the pod
+	// instead of killing in-flight LLM calls and message replies.
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Load config first
-	cfg := loadConfig(*config)
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config file")
+	}
 
-	// Use config values if flags are not set
-	if *appID == "" {
-		if id, ok := cfg["app_id"].(string); ok && id != "" {
-			*appID = id
-			log.Info().Msg("Using app_id from config file")
-		}
-	} else {
+	// Flags override config file values, but only on this first load: once
+	// the watcher below reloads from disk, the file is authoritative again.
+	if *appID != "" {
+		cfg.AppID = *appID
 		log.Info().Msg("Using app-id from command line flag")
 	}
+	if *appSecret != "" {
+		cfg.AppSecret = *appSecret
+		log.Info().Msg("Using app-secret from command line flag")
+	}
+	if *httpAddress != "" {
+		cfg.HTTPAddr = *httpAddress
+	} else if cfg.HTTPAddr == "" {
+		cfg.HTTPAddr = ":8080"
+	}
+	if *transportFlag != "" {
+		cfg.Transport = *transportFlag
+	}
+	if *shutdownGrace != 0 {
+		cfg.ShutdownGrace = shutdownGrace.String()
+	}
+	shutdownGraceDur := 10 * time.Second
+	if cfg.ShutdownGrace != "" {
+		if d, err := time.ParseDuration(cfg.ShutdownGrace); err == nil {
+			shutdownGraceDur = d
+		} else {
+			log.Warn().Err(err).Str("shutdown_grace", cfg.ShutdownGrace).Msg("invalid shutdown_grace, using default")
+		}
+	}
 
-	if *appSecret == "" {
-		if secret, ok := cfg["app_secret"].(string); ok && secret != "" {
-			*appSecret = secret
-			log.Info().Msg("Using app_secret from config file")
+	// apps is the list of Lark apps/tenants this process serves: either the
+	// single app described by the top-level app_id/app_secret/... fields, or
+	// the apps: list for multi-tenant deployments.
+	apps := cfg.AppsOrDefault()
+	for i, app := range apps {
+		if app.AppID == "" || app.AppSecret == "" {
+			log.Fatal().Int("index", i).Msg("app_id and app_secret must be provided for every app, either via the top-level app_id/app_secret in the config file or command-line flags (--app-id, --app-secret) for a single-tenant config, or under apps: in the config file.")
 		}
-	} else {
-		log.Info().Msg("Using app-secret from command line flag")
+		if app.BotName == "" {
+			// The Lark SDK has no bot-info lookup endpoint to fall back to,
+			// so bot_name has to be set explicitly rather than resolved
+			// from the app's own credentials.
+			log.Fatal().Int("index", i).Msg("bot_name must be set in the config for every app.")
+		}
+	}
+
+	transportMode, err := transport.ParseMode(cfg.Transport)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid --transport / transport: value")
 	}
 
-	// Check if appID and appSecret are set
-	if *appID == "" || *appSecret == "" {
-		log.Fatal().Msg("app_id and app_secret must be provided either via command-line flags (--app-id, --app-secret) or in the config file.")
+	// cfgPtr is what handlers read through; WatchFile swaps it on every
+	// config.yaml change so routing rules, allowed chats or LLM prompts can
+	// be updated without restarting the bot and dropping the connection.
+	var cfgPtr atomic.Pointer[config.Config]
+	cfgPtr.Store(cfg)
+	if watcher, err := config.WatchFile(*configFile, &cfgPtr); err != nil {
+		log.Warn().Err(err).Str("file", *configFile).Msg("Could not watch config file for changes; hot-reload disabled")
+	} else {
+		defer watcher.Close()
 	}
 
+	// Shared mux: health checks always live here, and in ModeHTTP the Lark
+	// event-callback endpoints are registered on it too so the process only
+	// needs one listener.
+	var shuttingDown atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if shuttingDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("shutting down"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+	})
+
+	// Prometheus registry for /metrics. handler.NewRootForMessage gets the
+	// Metrics registered on it, not the registry itself, so handlers record
+	// backend calls through Metrics.BackendDuration/BackendErrors and cannot
+	// register collectors of their own.
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := metrics.New(reg)
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	// net/http/pprof's init() only registers on http.DefaultServeMux, so wire
+	// the handlers onto our own mux by hand.
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
 	// Start the HTTP server in a separate goroutine
+	httpServer := &http.Server{Addr: cfg.HTTPAddr, Handler: mux}
 	go func() {
-		http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("OK"))
-		})
-		http.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("OK"))
-		})
-		log.Info().Msgf("Starting health check server on %s", *httpAddress)
-		if err := http.ListenAndServe(*httpAddress, nil); err != nil {
+		log.Info().Msgf("Starting health check server on %s", cfg.HTTPAddr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal().Err(err).Msg("Failed to start health check server")
 		}
 	}()
 
-	// Set up Lark (Feishu) WebSocket client
-	producerOpts := []lark.ClientOptionFunc{}
-	if *debugMode {
-		producerOpts = append(producerOpts, lark.WithLogLevel(larkcore.LogLevelDebug), lark.WithLogReqAtDebug(true))
-	} else {
-		producerOpts = append(producerOpts, lark.WithLogLevel(larkcore.LogLevelInfo))
-	}
-	// Use the potentially updated appID and appSecret
-	producerCli := lark.NewClient(*appID, *appSecret, producerOpts...)
-
-	// Get bot name at startup if not already in config
-	if _, ok := cfg["bot_name"].(string); !ok { // Removed check for *appID != "" && *appSecret != "" as we now ensure they are set
-		botName, err := botinfo.GetBotName(context.Background(), *appID, *appSecret)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to get bot name from API. Please verify your App ID and App Secret, and ensure the bot is properly configured in the Lark platform. Alternatively, set a default bot name in the config.")
-		} else if botName == "" {
-			log.Fatal().Msg("Retrieved empty bot name from API. Please check your app configuration.")
+	// inFlight tracks outstanding handler goroutines, across every app, so
+	// shutdown can wait for them to drain instead of killing them mid-reply.
+	var inFlight sync.WaitGroup
+	// wsClients holds one goroutine per app in ModeWS; Wait blocks until
+	// every one has stopped (on rootCtx cancellation or permanent failure).
+	var wsClients sync.WaitGroup
+
+	for i := range apps {
+		app := apps[i]
+
+		producerOpts := []lark.ClientOptionFunc{}
+		if *debugMode {
+			producerOpts = append(producerOpts, lark.WithLogLevel(larkcore.LogLevelDebug), lark.WithLogReqAtDebug(true))
 		} else {
-			log.Info().Str("botName", botName).Msg("Bot name retrieved from API successfully")
-			// Store the bot name in the config for later use
-			cfg["bot_name"] = botName
+			producerOpts = append(producerOpts, lark.WithLogLevel(larkcore.LogLevelInfo))
 		}
-	}
+		producerCli := lark.NewClient(app.AppID, app.AppSecret, producerOpts...)
 
-	eventHandler := dispatcher.NewEventDispatcher("", "").
-		OnP2MessageReceiveV1(handler.NewRootForMessage(producerCli, cfg))
+		appCtx := handler.AppContext{AppID: app.AppID, BotName: app.BotName}
 
-	consumerOpts := []larkws.ClientOption{larkws.WithEventHandler(eventHandler)}
-	if *debugMode {
-		consumerOpts = append(consumerOpts,
-			larkws.WithLogLevel(larkcore.LogLevelDebug),
-			larkws.WithAutoReconnect(true))
-	} else {
-		// Set log level to Warn in non-debug mode to avoid logging sensitive connection URLs
-		consumerOpts = append(consumerOpts, larkws.WithLogLevel(larkcore.LogLevelWarn))
+		// verification token / encrypt key are only required in ModeHTTP,
+		// where Lark signs and encrypts the webhook payload; the ws
+		// transport leaves them blank since the socket itself is already
+		// authenticated.
+		var verificationToken, encryptKey string
+		if transportMode == transport.ModeHTTP {
+			verificationToken, encryptKey = app.VerificationToken, app.EncryptKey
+		}
+
+		eventHandler := dispatcher.NewEventDispatcher(verificationToken, encryptKey).
+			OnP2MessageReceiveV1(handler.NewRootForMessage(producerCli, &cfgPtr, m, &inFlight, appCtx))
+
+		switch transportMode {
+		case transport.ModeHTTP:
+			// No interactive card UI is sent by this bot yet, so the card
+			// handler just acknowledges the action; it's wired up so
+			// /webhook/card answers Lark's url_verification challenge when
+			// the callback URL is registered in the developer console.
+			cardHandler := larkcard.NewCardActionHandler(verificationToken, encryptKey,
+				func(ctx context.Context, action *larkcard.CardAction) (interface{}, error) {
+					return nil, nil
+				})
+
+			// A single app keeps the plain /webhook/event and /webhook/card
+			// paths; multiple apps each get their own paths to register as
+			// distinct callback URLs in the Lark developer console.
+			pathAppID := ""
+			if len(apps) > 1 {
+				pathAppID = app.AppID
+			}
+			transport.RegisterHTTPEventHandlers(mux, pathAppID, eventHandler, cardHandler)
+			log.Info().Str("appId", app.AppID).Msg("Lark events handled over HTTP webhook")
+		default:
+			consumerOpts := []larkws.ClientOption{larkws.WithEventHandler(eventHandler)}
+			if *debugMode {
+				consumerOpts = append(consumerOpts,
+					larkws.WithLogLevel(larkcore.LogLevelDebug),
+					larkws.WithAutoReconnect(true))
+			} else {
+				// Set log level to Warn in non-debug mode to avoid logging sensitive connection URLs
+				consumerOpts = append(consumerOpts, larkws.WithLogLevel(larkcore.LogLevelWarn))
+			}
+
+			consumerOpts = append(consumerOpts, larkws.WithOnReconnecting(func() { m.WSReconnectTotal.Inc() }))
+			consumerCli := larkws.NewClient(app.AppID, app.AppSecret, consumerOpts...)
+
+			wsClients.Add(1)
+			go func(appID string) {
+				defer wsClients.Done()
+				// Start only honours ctx while it's connecting; once
+				// connected it runs go pingLoop(ctx); select{} forever, which
+				// nothing (including Close) wakes up. Calling Close on
+				// rootCtx.Done is still worthwhile best-effort cleanup -
+				// it disables auto-reconnect and tears down the socket -
+				// but it does NOT make Start return, so it must not be
+				// relied on to bound shutdown time; see the wsClients.Wait
+				// race below.
+				go func() {
+					<-rootCtx.Done()
+					consumerCli.Close()
+				}()
+				if err := consumerCli.Start(rootCtx); err != nil && rootCtx.Err() == nil {
+					log.Fatal().Err(err).Str("appId", appID).Msg("run failed for Lark WebSocket client")
+				}
+			}(app.AppID)
+		}
 	}
 
-	// Use the potentially updated appID and appSecret
-	consumerCli := larkws.NewClient(*appID, *appSecret, consumerOpts...)
-	// Now start the WebSocket client (blocking call)
-	err := consumerCli.Start(context.Background())
-	if err != nil {
-		log.Fatal().Err(err).Msg("run failed for Lark WebSocket client")
+	// Both transports key off rootCtx.Done, not wsClients.Wait: larkws.Client
+	// has no real cancellation path once connected (see the goroutine
+	// above), so waiting on it directly here would hang shutdown forever
+	// for any app that has ever connected.
+	<-rootCtx.Done()
+
+	log.Info().Msg("shutdown signal received, draining in-flight handlers")
+	shuttingDown.Store(true)
+
+	// One grace period covers the drain wait, the ws-client wait and the
+	// HTTP server shutdown below, not one each, so a caller-configured
+	// shutdown_grace of 10s still bounds total shutdown time at 10s instead
+	// of up to 30s.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGraceDur)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Info().Msg("in-flight handlers drained")
+	case <-shutdownCtx.Done():
+		log.Warn().Dur("grace", shutdownGraceDur).Msg("shutdown grace period elapsed with handlers still in flight")
 	}
-}
 
-// loadConfig loads the YAML config into a map[string]any
-func loadConfig(file string) map[string]any {
-	f, err := os.Open(file)
-	if err != nil {
-		// Log warning instead of fatal if config doesn't exist, return empty map
-		if os.IsNotExist(err) {
-			log.Warn().Str("file", file).Msg("Config file not found, continuing without it.")
-			return make(map[string]any)
+	if transportMode != transport.ModeHTTP {
+		// wsClients.Wait can't be trusted to return (Start never does once
+		// connected), so race it against the same shutdownCtx instead of
+		// blocking process exit on it; the ws connection(s) may linger past
+		// exit if it doesn't win the race.
+		wsDone := make(chan struct{})
+		go func() {
+			wsClients.Wait()
+			close(wsDone)
+		}()
+		select {
+		case <-wsDone:
+			log.Info().Msg("ws client(s) stopped")
+		case <-shutdownCtx.Done():
+			log.Warn().Msg("shutdown grace period elapsed with ws client(s) still connected; abandoning them at process exit")
 		}
-		log.Fatal().Err(err).Msg("failed to open config file")
 	}
-	defer f.Close()
 
-	var cfg map[string]any
-	err = yaml.NewDecoder(f).Decode(&cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to decode config file")
-	}
-	// Initialize map if file is empty
-	if cfg == nil {
-		cfg = make(map[string]any)
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("error shutting down health server")
 	}
-	return cfg
 }
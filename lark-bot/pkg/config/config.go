@@ -0,0 +1,100 @@
+// Package config defines the bot's structured configuration and loads it
+// from YAML, replacing the previous map[string]any passed around by hand.
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is one routing rule: which chats/messages it applies to and what the
+// handler should do with them (e.g. which LLM prompt to use).
+type Rule struct {
+	Name   string `yaml:"name"`
+	Match  string `yaml:"match"`
+	Prompt string `yaml:"prompt"`
+}
+
+// AppConfig is one Lark (Feishu) app/tenant the process serves. Teams that
+// deploy the same bot across multiple tenants declare one entry per tenant
+// under `apps:` instead of running a copy of the binary per tenant.
+type AppConfig struct {
+	AppID             string `yaml:"app_id"`
+	AppSecret         string `yaml:"app_secret"`
+	BotName           string `yaml:"bot_name"`
+	VerificationToken string `yaml:"verification_token"`
+	EncryptKey        string `yaml:"encrypt_key"`
+
+	// HandlerRules overrides Config.HandlerRules for this app when set.
+	HandlerRules []Rule `yaml:"handler_rules"`
+}
+
+// Config is the bot's full configuration, loaded from config.yaml and
+// optionally hot-reloaded; see Load and WatchFile.
+type Config struct {
+	// AppID/AppSecret/... below describe a single app and are kept for
+	// backward compatibility with single-tenant config files; AppsOrDefault
+	// wraps them as the sole entry when Apps is empty.
+	AppID     string `yaml:"app_id"`
+	AppSecret string `yaml:"app_secret"`
+	BotName   string `yaml:"bot_name"`
+
+	VerificationToken string `yaml:"verification_token"`
+	EncryptKey        string `yaml:"encrypt_key"`
+
+	// Apps declares multiple tenants sharing this process; see AppConfig.
+	Apps []AppConfig `yaml:"apps"`
+
+	HTTPAddr string `yaml:"http_addr"`
+	LogLevel string `yaml:"log_level"`
+
+	// Transport is "ws" (default) or "http"; see pkg/transport.
+	Transport string `yaml:"transport"`
+
+	HandlerRules []Rule `yaml:"handler_rules"`
+
+	// ShutdownGrace is a time.ParseDuration string, e.g. "10s". Empty means
+	// the built-in default.
+	ShutdownGrace string `yaml:"shutdown_grace"`
+}
+
+// AppsOrDefault returns Apps, or a single AppConfig built from the top-level
+// AppID/AppSecret/... fields when Apps is empty, so single-tenant config
+// files keep working unchanged.
+func (c *Config) AppsOrDefault() []AppConfig {
+	if len(c.Apps) > 0 {
+		return c.Apps
+	}
+	return []AppConfig{{
+		AppID:             c.AppID,
+		AppSecret:         c.AppSecret,
+		BotName:           c.BotName,
+		VerificationToken: c.VerificationToken,
+		EncryptKey:        c.EncryptKey,
+	}}
+}
+
+// Load reads and decodes file into a Config. A missing file is not an error:
+// it logs a warning and returns a zero-value Config, matching the previous
+// loadConfig behaviour.
+func Load(file string) (*Config, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Warn().Str("file", file).Msg("Config file not found, continuing without it.")
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg Config
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &cfg, nil
+}
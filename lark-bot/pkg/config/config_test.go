@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("missing file returns zero-value config", func(t *testing.T) {
+		cfg, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(cfg, &Config{}) {
+			t.Errorf("Load() = %+v, want zero-value Config", cfg)
+		}
+	})
+
+	t.Run("empty file returns zero-value config", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		cfg, err := Load(file)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(cfg, &Config{}) {
+			t.Errorf("Load() = %+v, want zero-value Config", cfg)
+		}
+	})
+
+	t.Run("decodes yaml", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		content := "app_id: app-1\napp_secret: secret-1\nbot_name: bot\ntransport: http\n"
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		cfg, err := Load(file)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		want := &Config{AppID: "app-1", AppSecret: "secret-1", BotName: "bot", Transport: "http"}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("Load() = %+v, want %+v", cfg, want)
+		}
+	})
+}
+
+func TestConfigAppsOrDefault(t *testing.T) {
+	t.Run("single-tenant fields become the sole entry", func(t *testing.T) {
+		cfg := &Config{AppID: "app-1", AppSecret: "secret-1", BotName: "bot"}
+		got := cfg.AppsOrDefault()
+		want := []AppConfig{{AppID: "app-1", AppSecret: "secret-1", BotName: "bot"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("AppsOrDefault() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("apps list takes precedence", func(t *testing.T) {
+		apps := []AppConfig{{AppID: "app-2", AppSecret: "secret-2", BotName: "bot-2"}}
+		cfg := &Config{AppID: "app-1", AppSecret: "secret-1", Apps: apps}
+		got := cfg.AppsOrDefault()
+		if !reflect.DeepEqual(got, apps) {
+			t.Errorf("AppsOrDefault() = %+v, want %+v", got, apps)
+		}
+	})
+}
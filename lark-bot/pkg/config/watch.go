@@ -0,0 +1,81 @@
+package config
+
+import (
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// Watcher reloads Config from its source file on change and atomically
+// swaps it into current, so readers (via current.Load()) see the update
+// without a restart.
+type Watcher struct {
+	file    string
+	current *atomic.Pointer[Config]
+	fw      *fsnotify.Watcher
+}
+
+// WatchFile starts watching file for changes, reloading into current on
+// every write. current must already hold the initially-loaded Config.
+func WatchFile(file string, current *atomic.Pointer[Config]) (*Watcher, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the parent directory rather than the file itself: editors and
+	// config-management tools commonly save by writing a temp file and
+	// renaming it over the target, which drops the original inode (and
+	// fsnotify's watch on it) instead of emitting a Write event.
+	if err := fw.Add(filepath.Dir(absFile)); err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+
+	w := &Watcher{file: absFile, current: current, fw: fw}
+	go w.loop()
+	return w, nil
+}
+
+func (w *Watcher) loop() {
+	for {
+		select {
+		case event, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			// The directory watch sees every file in it; only react to our
+			// own file.
+			if event.Name != w.file {
+				continue
+			}
+			// Editors often replace the file rather than write in place, so
+			// reload on Create too, not just Write.
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+
+			cfg, err := Load(w.file)
+			if err != nil {
+				log.Warn().Err(err).Str("file", w.file).Msg("Failed to reload config, keeping previous version")
+				continue
+			}
+			w.current.Store(cfg)
+			log.Info().Str("file", w.file).Msg("Config reloaded")
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			log.Warn().Err(err).Msg("Config watcher error")
+		}
+	}
+}
+
+// Close stops the watcher.
+func (w *Watcher) Close() error { return w.fw.Close() }
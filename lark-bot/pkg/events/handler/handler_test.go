@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wuhuizuo/caffeine-overflow/lark-bot/pkg/config"
+)
+
+func TestAppContextRules(t *testing.T) {
+	defaultRules := []config.Rule{{Name: "default"}}
+	appRules := []config.Rule{{Name: "app-1-override"}}
+	cfg := &config.Config{
+		HandlerRules: defaultRules,
+		Apps: []config.AppConfig{
+			{AppID: "app-1", HandlerRules: appRules},
+			{AppID: "app-2"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		app  AppContext
+		want []config.Rule
+	}{
+		{"app with override", AppContext{AppID: "app-1"}, appRules},
+		{"app without override falls back to default", AppContext{AppID: "app-2"}, defaultRules},
+		{"unknown app falls back to default", AppContext{AppID: "app-3"}, defaultRules},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.app.rules(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
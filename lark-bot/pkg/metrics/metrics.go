@@ -0,0 +1,67 @@
+// Package metrics defines the bot's Prometheus instrumentation: event
+// throughput, handler latency, backend call duration/errors and WebSocket
+// connection health.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics holds the collectors shared across the message pipeline. Handlers
+// registered via handler.NewRootForMessage get a *Metrics so they can record
+// their own backend-call durations alongside the pipeline-wide ones.
+type Metrics struct {
+	EventsReceived   *prometheus.CounterVec
+	HandlerLatency   *prometheus.HistogramVec
+	HandlerInFlight  prometheus.Gauge
+	BackendDuration  *prometheus.HistogramVec
+	BackendErrors    *prometheus.CounterVec
+	WSReconnectTotal prometheus.Counter
+}
+
+// New creates the collectors and registers them on reg.
+func New(reg *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		EventsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "caffeine_overflow",
+			Name:      "events_received_total",
+			Help:      "Lark events received, by event type.",
+		}, []string{"event_type"}),
+		HandlerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "caffeine_overflow",
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in the root message handler, by event type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"event_type"}),
+		HandlerInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "caffeine_overflow",
+			Name:      "handlers_in_flight",
+			Help:      "Number of message handlers currently running.",
+		}),
+		BackendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "caffeine_overflow",
+			Name:      "backend_call_duration_seconds",
+			Help:      "Duration of outbound LLM/backend calls, by backend.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend"}),
+		BackendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "caffeine_overflow",
+			Name:      "backend_call_errors_total",
+			Help:      "Failed outbound LLM/backend calls, by backend.",
+		}, []string{"backend"}),
+		WSReconnectTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "caffeine_overflow",
+			Name:      "ws_reconnect_total",
+			Help:      "WebSocket client reconnects.",
+		}),
+	}
+
+	reg.MustRegister(
+		m.EventsReceived,
+		m.HandlerLatency,
+		m.HandlerInFlight,
+		m.BackendDuration,
+		m.BackendErrors,
+		m.WSReconnectTotal,
+	)
+
+	return m
+}
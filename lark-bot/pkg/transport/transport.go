@@ -0,0 +1,57 @@
+// Package transport selects how the bot receives Lark (Feishu) events: the
+// default long-polling WebSocket connection, or an HTTP event-callback mode
+// for deployments without outbound WebSocket access.
+package transport
+
+import (
+	"fmt"
+	"net/http"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	"github.com/larksuite/oapi-sdk-go/v3/core/httpserverext"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
+)
+
+// Mode is how the bot receives events from Lark.
+type Mode string
+
+const (
+	// ModeWS keeps the long-polling WebSocket connection (larkws.Client).
+	ModeWS Mode = "ws"
+	// ModeHTTP registers HTTP event-callback endpoints instead.
+	ModeHTTP Mode = "http"
+)
+
+// ParseMode validates a --transport flag / config `transport:` value,
+// defaulting to ModeWS when s is empty.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeWS:
+		return ModeWS, nil
+	case ModeHTTP:
+		return ModeHTTP, nil
+	default:
+		return "", fmt.Errorf("unknown transport mode %q (want %q or %q)", s, ModeWS, ModeHTTP)
+	}
+}
+
+// RegisterHTTPEventHandlers mounts the Lark HTTP event-callback endpoints for
+// one app on mux: /webhook/event for message/event callbacks and
+// /webhook/card for interactive card actions. Both handlers must have been
+// constructed with that app's verification token and encrypt key
+// (dispatcher.NewEventDispatcher / larkcard.NewCardActionHandler) so they can
+// verify the signature, decrypt the `encrypt` field and answer the
+// url_verification challenge themselves, before any registered callback
+// runs.
+//
+// appID scopes the paths so a multi-tenant process can register one pair of
+// handlers per app (each configured with its own callback URL in the Lark
+// developer console); pass "" for the single-tenant default paths.
+func RegisterHTTPEventHandlers(mux *http.ServeMux, appID string, eventHandler *dispatcher.EventDispatcher, cardHandler *larkcard.CardActionHandler) {
+	eventPath, cardPath := "/webhook/event", "/webhook/card"
+	if appID != "" {
+		eventPath, cardPath = eventPath+"/"+appID, cardPath+"/"+appID
+	}
+	mux.HandleFunc(eventPath, httpserverext.NewEventHandlerFunc(eventHandler))
+	mux.HandleFunc(cardPath, httpserverext.NewCardActionHandlerFunc(cardHandler))
+}
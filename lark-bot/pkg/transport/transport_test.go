@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	larkevent "github.com/larksuite/oapi-sdk-go/v3/event"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+func noopCardHandler(verificationToken, encryptKey string) *larkcard.CardActionHandler {
+	return larkcard.NewCardActionHandler(verificationToken, encryptKey,
+		func(ctx context.Context, action *larkcard.CardAction) (interface{}, error) { return nil, nil })
+}
+
+func TestRegisterHTTPEventHandlers_ChallengeHandshake(t *testing.T) {
+	const verificationToken = "verify-token"
+
+	eventHandler := dispatcher.NewEventDispatcher(verificationToken, "")
+	mux := http.NewServeMux()
+	RegisterHTTPEventHandlers(mux, "", eventHandler, noopCardHandler(verificationToken, ""))
+
+	body := []byte(`{"type":"url_verification","challenge":"chal-123","token":"` + verificationToken + `"}`)
+
+	for _, path := range []string{"/webhook/event", "/webhook/card"} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", path, rec.Code, rec.Body.String())
+		}
+
+		var got struct {
+			Challenge string `json:"challenge"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: unmarshal response: %v", path, err)
+		}
+		if got.Challenge != "chal-123" {
+			t.Errorf("%s: challenge = %q, want %q", path, got.Challenge, "chal-123")
+		}
+	}
+}
+
+func TestRegisterHTTPEventHandlers_EncryptedEvent(t *testing.T) {
+	const encryptKey = "event-encrypt-key"
+
+	received := make(chan *larkim.P2MessageReceiveV1, 1)
+	eventHandler := dispatcher.NewEventDispatcher("", encryptKey).
+		OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
+			received <- event
+			return nil
+		})
+	mux := http.NewServeMux()
+	RegisterHTTPEventHandlers(mux, "", eventHandler, noopCardHandler("", encryptKey))
+
+	plain := []byte(`{"schema":"2.0","header":{"event_id":"1","event_type":"im.message.receive_v1","app_id":"cli_x","tenant_key":"t1","create_time":"1700000000000","token":"ignored-for-encrypted-events"},"event":{"message":{"message_id":"om_1","chat_id":"oc_1"}}}`)
+	encrypted := encryptForTest(t, encryptKey, plain)
+	body, err := json.Marshal(map[string]string{"encrypt": encrypted})
+	if err != nil {
+		t.Fatalf("marshal request body: %v", err)
+	}
+
+	const timestamp, nonce = "1700000000", "test-nonce"
+	req := httptest.NewRequest(http.MethodPost, "/webhook/event", bytes.NewReader(body))
+	req.Header.Set(larkevent.EventRequestTimestamp, timestamp)
+	req.Header.Set(larkevent.EventRequestNonce, nonce)
+	req.Header.Set(larkevent.EventSignature, larkevent.Signature(timestamp, nonce, encryptKey, string(body)))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case event := <-received:
+		if got := *event.Event.Message.MessageId; got != "om_1" {
+			t.Errorf("message_id = %q, want %q", got, "om_1")
+		}
+	default:
+		t.Fatal("OnP2MessageReceiveV1 handler was not called")
+	}
+}
+
+// encryptForTest mirrors the AES-256-CBC scheme used by larkevent.EventDecrypt
+// (key = sha256(secret), random IV prepended to the ciphertext, both
+// base64-encoded), so the dispatcher can decrypt it the same way Lark's
+// servers do for a real webhook call.
+func encryptForTest(t *testing.T, secret string, plaintext []byte) string {
+	t.Helper()
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatalf("new cipher: %v", err)
+	}
+
+	padded := pkcs7Pad(plaintext, aes.BlockSize)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("read iv: %v", err)
+	}
+
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	return base64.StdEncoding.EncodeToString(append(iv, ciphertext...))
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padLen := blockSize - len(data)%blockSize
+	return append(data, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+}